@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"gopkg.in/redis.v5"
+)
+
+// ErrCacheMiss is returned by Cache.Get when the key doesn't exist or has
+// expired, regardless of which backend is in use.
+var ErrCacheMiss = errors.New("cache: key not found")
+
+// Cache is the storage backend used for GitHub token storage and cached
+// traffic stats. redisCache is the production backend; memCache lets the
+// module run as a single binary with no external dependencies.
+type Cache interface {
+	Get(key string) ([]byte, error)
+	Set(key string, val []byte, ttl time.Duration) error
+	Delete(key string) error
+}
+
+// newCache builds a Cache from a URL like "redis://:password@host:port" or
+// "mem://", mirroring the URL-driven backend selection common to badge
+// services.
+func newCache(rawurl string) (Cache, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CACHE url: %w", err)
+	}
+
+	switch u.Scheme {
+	case "redis":
+		password := ""
+		if u.User != nil {
+			password, _ = u.User.Password()
+		}
+		return newRedisCache(u.Host, password), nil
+	case "mem":
+		return newMemCache(), nil
+	default:
+		return nil, fmt.Errorf("unknown CACHE scheme: %s", u.Scheme)
+	}
+}
+
+type redisCache struct {
+	client *redis.Client
+}
+
+func newRedisCache(addr, password string) *redisCache {
+	return &redisCache{client: redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+	})}
+}
+
+func (c *redisCache) Get(key string) ([]byte, error) {
+	val, err := c.client.Get(key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrCacheMiss
+	}
+	return val, err
+}
+
+func (c *redisCache) Set(key string, val []byte, ttl time.Duration) error {
+	return c.client.Set(key, val, ttl).Err()
+}
+
+func (c *redisCache) Delete(key string) error {
+	return c.client.Del(key).Err()
+}
+
+// memCache is a TTL map guarded by a mutex, swept periodically so expired
+// entries don't pile up between reads.
+type memCache struct {
+	mu      sync.RWMutex
+	entries map[string]memCacheEntry
+}
+
+type memCacheEntry struct {
+	value   []byte
+	expires time.Time // zero means "never expires"
+}
+
+func newMemCache() *memCache {
+	c := &memCache{entries: make(map[string]memCacheEntry)}
+	go c.sweep()
+	return c
+}
+
+func (c *memCache) sweep() {
+	for range time.Tick(time.Minute) {
+		now := time.Now()
+		c.mu.Lock()
+		for key, entry := range c.entries {
+			if !entry.expires.IsZero() && now.After(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *memCache) Get(key string) ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[key]
+	if !ok || (!entry.expires.IsZero() && time.Now().After(entry.expires)) {
+		return nil, ErrCacheMiss
+	}
+	return entry.value, nil
+}
+
+func (c *memCache) Set(key string, val []byte, ttl time.Duration) error {
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	c.entries[key] = memCacheEntry{value: val, expires: expires}
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *memCache) Delete(key string) error {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// dashboard lists the embed tokens a user has generated for their repos
+// and offers a form to mint new ones. requireSession makes sure the
+// caller actually is :user -- the session cookie set at /_callback -- not
+// just someone who knows their GitHub login.
+func dashboard(c echo.Context) error {
+	if err := requireSession(c); err != nil {
+		return err
+	}
+
+	user := c.Param("user")
+	if _, err := cache.Get("token:" + user); err != nil {
+		return echo.NewHTTPError(404, "user doesn't have a valid GitHub token registered.")
+	}
+
+	tokens, err := listEmbedTokens(user)
+	if err != nil {
+		return err
+	}
+
+	var rows strings.Builder
+	for _, claims := range tokens {
+		fmt.Fprintf(&rows,
+			`<li>%s (expires %s) &mdash; <a href="/dashboard/%s/revoke?id=%s">revoke</a></li>`,
+			html.EscapeString(claims.RepoGlob), time.Unix(claims.Exp, 0).Format(time.RFC1123),
+			html.EscapeString(user), html.EscapeString(claims.ID),
+		)
+	}
+
+	return c.HTML(200, fmt.Sprintf(`<h1>%s's embed tokens</h1>
+<ul>%s</ul>
+<form action="/dashboard/%s/mint" method="get">
+	<input name="repo" placeholder="owner/repo or owner/*">
+	<button type="submit">generate embed link</button>
+</form>`, html.EscapeString(user), rows.String(), html.EscapeString(user)))
+}
+
+// mintToken generates a new embed token scoped to the given repo glob and
+// remembers it so it shows up on the dashboard and can be revoked later.
+func mintToken(c echo.Context) error {
+	if err := requireSession(c); err != nil {
+		return err
+	}
+
+	user := c.Param("user")
+	if _, err := cache.Get("token:" + user); err != nil {
+		return echo.NewHTTPError(404, "user doesn't have a valid GitHub token registered.")
+	}
+
+	repoGlob := c.QueryParam("repo")
+	if repoGlob == "" {
+		return echo.NewHTTPError(400, "missing ?repo= glob, e.g. owner/repo or owner/*")
+	}
+
+	token, claims, err := mintEmbedToken(user, repoGlob, embedTokenDefaultTTL)
+	if err != nil {
+		return err
+	}
+
+	if err := rememberEmbedToken(user, claims); err != nil {
+		return err
+	}
+
+	return c.String(200, token)
+}
+
+// revokeToken adds a previously minted token to the revocation list so it
+// stops being accepted as a `?t=` param.
+func revokeToken(c echo.Context) error {
+	if err := requireSession(c); err != nil {
+		return err
+	}
+
+	user := c.Param("user")
+	id := c.QueryParam("id")
+	if id == "" {
+		return echo.NewHTTPError(400, "missing ?id=")
+	}
+
+	if err := revokeEmbedToken(user, id); err != nil {
+		return err
+	}
+
+	return c.Redirect(302, "/dashboard/"+user)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	ErrEmbedTokenInvalid = errors.New("embed token is invalid")
+	ErrEmbedTokenExpired = errors.New("embed token has expired")
+	ErrEmbedTokenRevoked = errors.New("embed token has been revoked")
+)
+
+// embedTokenDefaultTTL is how long a freshly minted embed token is valid
+// for before the owner has to generate a new one.
+const embedTokenDefaultTTL = time.Hour * 24 * 30
+
+// embedClaims is the payload encoded into a signed embed token: it scopes
+// the token to a single GitHub user's traffic data, a repo glob (e.g.
+// "fiatjaf/ght" or "fiatjaf/*"), and an expiry.
+type embedClaims struct {
+	ID       string `json:"id"`
+	User     string `json:"user"`
+	RepoGlob string `json:"repo_glob"`
+	Exp      int64  `json:"exp"`
+}
+
+// mintEmbedToken signs a new embed token scoped to user and repoGlob,
+// valid for ttl, and returns both the token string and the claims it
+// encodes (so the caller can remember it for the dashboard).
+func mintEmbedToken(user, repoGlob string, ttl time.Duration) (string, embedClaims, error) {
+	id, err := randomID()
+	if err != nil {
+		return "", embedClaims{}, err
+	}
+
+	claims := embedClaims{
+		ID:       id,
+		User:     user,
+		RepoGlob: repoGlob,
+		Exp:      time.Now().Add(ttl).Unix(),
+	}
+
+	token, err := signEmbedClaims(claims)
+	if err != nil {
+		return "", embedClaims{}, err
+	}
+
+	return token, claims, nil
+}
+
+// verifyEmbedToken checks a token's signature, expiry and revocation
+// status, and returns the claims it encodes.
+func verifyEmbedToken(token string) (embedClaims, error) {
+	dot := strings.LastIndex(token, ".")
+	if dot < 0 {
+		return embedClaims{}, ErrEmbedTokenInvalid
+	}
+	encodedPayload, sig := token[:dot], token[dot+1:]
+
+	if !hmac.Equal([]byte(sig), []byte(signEmbedPayload(encodedPayload))) {
+		return embedClaims{}, ErrEmbedTokenInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return embedClaims{}, ErrEmbedTokenInvalid
+	}
+
+	var claims embedClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return embedClaims{}, ErrEmbedTokenInvalid
+	}
+
+	if time.Now().Unix() > claims.Exp {
+		return embedClaims{}, ErrEmbedTokenExpired
+	}
+
+	if revoked, err := cache.Get("revoked:" + claims.ID); err == nil && len(revoked) > 0 {
+		return embedClaims{}, ErrEmbedTokenRevoked
+	}
+
+	return claims, nil
+}
+
+func signEmbedClaims(claims embedClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	return encodedPayload + "." + signEmbedPayload(encodedPayload), nil
+}
+
+func signEmbedPayload(encodedPayload string) string {
+	mac := hmac.New(sha256.New, []byte(s.EmbedSecret))
+	mac.Write([]byte(encodedPayload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// repoGlobMatches reports whether repo (e.g. "fiatjaf/ght") is covered by
+// glob (e.g. "fiatjaf/ght" or "fiatjaf/*").
+func repoGlobMatches(glob, repo string) bool {
+	matched, err := path.Match(glob, repo)
+	return err == nil && matched
+}
+
+func randomID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// revokeEmbedToken marks id as revoked -- until its original expiry, since
+// there's no point remembering a revocation past the point the token
+// would've stopped working anyway -- and drops it from user's listing.
+func revokeEmbedToken(user, id string) error {
+	tokens, err := listEmbedTokens(user)
+	if err != nil {
+		return err
+	}
+
+	var exp int64
+	kept := tokens[:0]
+	for _, claims := range tokens {
+		if claims.ID == id {
+			exp = claims.Exp
+			continue
+		}
+		kept = append(kept, claims)
+	}
+
+	ttl := time.Until(time.Unix(exp, 0))
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	if err := cache.Set("revoked:"+id, []byte("1"), ttl); err != nil {
+		return err
+	}
+
+	return saveEmbedTokens(user, kept)
+}
+
+// listEmbedTokens returns the embed tokens registered for user's dashboard.
+func listEmbedTokens(user string) ([]embedClaims, error) {
+	raw, err := cache.Get("tokens:" + user)
+	if err != nil || len(raw) == 0 {
+		return nil, nil
+	}
+
+	var tokens []embedClaims
+	if err := json.Unmarshal(raw, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// rememberEmbedToken adds claims to user's listing so it shows up on the
+// dashboard and can be revoked later.
+func rememberEmbedToken(user string, claims embedClaims) error {
+	tokens, err := listEmbedTokens(user)
+	if err != nil {
+		return err
+	}
+	return saveEmbedTokens(user, append(tokens, claims))
+}
+
+func saveEmbedTokens(user string, tokens []embedClaims) error {
+	payload, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+	return cache.Set("tokens:"+user, payload, 0)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// staleCacheTTL is how long a successfully fetched response stays available
+// as a fallback after its normal TTL has expired.
+const staleCacheTTL = time.Hour * 24
+
+// ErrRateLimited is returned by githubClient.Get when GitHub's rate limit
+// is known to be exhausted, either because the previous response said so
+// or because we're preemptively refusing to burn the remaining budget. It's
+// an *echo.HTTPError so it reaches the client as a 429 instead of falling
+// through Echo's default error handler as a generic 500.
+var ErrRateLimited = echo.NewHTTPError(429, "github: rate limit exceeded")
+
+const (
+	githubRequestTimeout = 1500 * time.Millisecond
+	githubMaxRetries     = 3
+	githubRetryBackoff   = 200 * time.Millisecond
+	githubUserAgent      = "https://github.com/fiatjaf/ght"
+)
+
+// githubClient is a shared *http.Client wrapper for talking to the GitHub
+// API: it attaches auth/headers once per client instead of per handler,
+// retries on 5xx and 403 responses, and tracks the rate-limit budget from
+// GitHub's X-RateLimit-* headers so we can fail fast instead of burning a
+// request we already know will be rejected.
+type githubClient struct {
+	http *http.Client
+
+	mu        sync.Mutex
+	remaining int
+	resetAt   time.Time
+}
+
+// newGitHubClient builds a client that authenticates every request as
+// token via the chained auth/headers/retry transports.
+func newGitHubClient(token string) *githubClient {
+	var transport http.RoundTripper = http.DefaultTransport
+	transport = &retryTransport{next: transport, maxRetries: githubMaxRetries}
+	transport = &headersTransport{next: transport}
+	transport = &authTransport{next: transport, token: token}
+
+	return &githubClient{
+		http:      &http.Client{Timeout: githubRequestTimeout, Transport: transport},
+		remaining: 1, // unknown budget; assume available until GitHub tells us otherwise
+	}
+}
+
+var (
+	githubClientsMu sync.Mutex
+	githubClients   = map[string]*githubClient{}
+)
+
+// sharedGitHubClient returns the githubClient for token, creating one the
+// first time it's seen. Handlers are per-request, so without this the
+// rate-limit budget tracked on a githubClient would be thrown away at the
+// end of every single request instead of persisting until GitHub's window
+// resets.
+func sharedGitHubClient(token string) *githubClient {
+	githubClientsMu.Lock()
+	defer githubClientsMu.Unlock()
+
+	if gh, ok := githubClients[token]; ok {
+		return gh
+	}
+
+	gh := newGitHubClient(token)
+	githubClients[token] = gh
+	return gh
+}
+
+// Get fetches url and decodes the JSON response body into result.
+func (gh *githubClient) Get(url string, result interface{}) error {
+	gh.mu.Lock()
+	limited := gh.remaining <= 0 && time.Now().Before(gh.resetAt)
+	gh.mu.Unlock()
+	if limited {
+		return ErrRateLimited
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := gh.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	gh.recordRateLimit(resp.Header)
+
+	if resp.StatusCode == 403 {
+		return ErrRateLimited
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("github: %s replied with status %d", url, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (gh *githubClient) recordRateLimit(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	resetUnix, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	gh.mu.Lock()
+	gh.remaining = remaining
+	gh.resetAt = time.Unix(resetUnix, 0)
+	gh.mu.Unlock()
+}
+
+// fetchCached serves rediskey from cache if a fresh copy is there,
+// otherwise calls fetch to get one from GitHub and caches it for ttl. If
+// fetch fails -- GitHub is down, unreachable, or rate-limiting us -- and a
+// previously fetched copy is still around (even if past its ttl), that
+// stale copy is served instead, flagged with a Warning header, rather than
+// failing the request outright.
+func fetchCached(c echo.Context, rediskey string, ttl time.Duration, fetch func() ([]byte, error)) ([]byte, error) {
+	if fresh, err := cache.Get(rediskey); err == nil && len(fresh) > 0 {
+		return fresh, nil
+	}
+
+	data, err := fetch()
+	if err != nil {
+		if stale, staleErr := cache.Get(rediskey + ":stale"); staleErr == nil && len(stale) > 0 {
+			c.Response().Header().Set("Warning", `110 - "Response is Stale"`)
+			return stale, nil
+		}
+		return nil, err
+	}
+
+	if err := cache.Set(rediskey, data, ttl); err != nil {
+		log.Print("failed to cache results: ", err)
+	}
+	if err := cache.Set(rediskey+":stale", data, staleCacheTTL); err != nil {
+		log.Print("failed to cache stale fallback: ", err)
+	}
+
+	return data, nil
+}
+
+// authTransport sets the Authorization header so handlers don't each have
+// to repeat it.
+type authTransport struct {
+	next  http.RoundTripper
+	token string
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.token != "" {
+		req.Header.Set("Authorization", "token "+t.token)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// headersTransport sets the User-Agent and Accept headers GitHub's API
+// expects on every request.
+type headersTransport struct {
+	next http.RoundTripper
+}
+
+func (t *headersTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set("User-Agent", githubUserAgent)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	return t.next.RoundTrip(req)
+}
+
+// retryTransport retries on 5xx and 403 (rate-limit) responses with
+// exponential backoff. It's only safe for requests without a body, which
+// is all this module sends to the GitHub API.
+type retryTransport struct {
+	next       http.RoundTripper
+	maxRetries int
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := githubRetryBackoff
+
+	var resp *http.Response
+	var err error
+	for attempt := 0; ; attempt++ {
+		resp, err = t.next.RoundTrip(req)
+		if err == nil && resp.StatusCode < 500 && resp.StatusCode != 403 {
+			return resp, nil
+		}
+		if attempt >= t.maxRetries {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
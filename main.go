@@ -6,6 +6,8 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
@@ -13,21 +15,20 @@ import (
 	"github.com/wcharczuk/go-chart"
 	"github.com/wcharczuk/go-chart/drawing"
 	"gopkg.in/jmcvetta/napping.v3"
-	"gopkg.in/redis.v5"
 )
 
 type Settings struct {
 	Host               string `envconfig:"HOST" required:"true"`
 	Port               string `envconfig:"PORT" required:"true"`
-	RedisAddr          string `envconfig:"REDIS_ADDR" required:"true"`
-	RedisPassword      string `envconfig:"REDIS_PASSWORD" required:"true"`
+	Cache              string `envconfig:"CACHE" default:"mem://"`
 	GitHubClientId     string `envconfig:"GITHUB_CLIENT_ID" required:"true"`
 	GitHubClientSecret string `envconfig:"GITHUB_CLIENT_SECRET" required:"true"`
+	EmbedSecret        string `envconfig:"EMBED_SECRET" required:"true"`
 }
 
 var err error
 var s Settings
-var rds *redis.Client
+var cache Cache
 
 func main() {
 	err = envconfig.Process("", &s)
@@ -35,11 +36,10 @@ func main() {
 		log.Fatal("couldn't process envconfig: ", err)
 	}
 
-	// redis
-	rds = redis.NewClient(&redis.Options{
-		Addr:     s.RedisAddr,
-		Password: s.RedisPassword,
-	})
+	cache, err = newCache(s.Cache)
+	if err != nil {
+		log.Fatal("couldn't set up cache: ", err)
+	}
 
 	e := echo.New()
 
@@ -47,6 +47,13 @@ func main() {
 	e.GET("/_authorize", authorize)
 	e.GET("/_callback", authorizeCallback)
 	e.GET("/:user/:repo", drawChart)
+	e.GET("/:user/:repo/badge.svg", drawBadge)
+	e.GET("/:user/:repo/clones", drawClones)
+	e.GET("/:user/:repo/referrers", drawReferrers)
+	e.GET("/:user/:repo/paths", drawPaths)
+	e.GET("/dashboard/:user", dashboard)
+	e.GET("/dashboard/:user/mint", mintToken)
+	e.GET("/dashboard/:user/revoke", revokeToken)
 
 	log.Fatal(e.Start(":" + os.Getenv("PORT")))
 }
@@ -115,7 +122,12 @@ func authorizeCallback(c echo.Context) error {
 		return err
 	}
 
-	if err = rds.Set("token:"+user.Login, res.AccessToken, 0).Err(); err != nil {
+	if err = cache.Set("token:"+user.Login, []byte(res.AccessToken), 0); err != nil {
+		log.Print(err)
+		return err
+	}
+
+	if err := setSessionCookie(c, user.Login); err != nil {
 		log.Print(err)
 		return err
 	}
@@ -134,55 +146,100 @@ type GitHubStats struct {
 	} `json:"views"`
 }
 
-func drawChart(c echo.Context) error {
-	// get token for this user
-	authUser := c.QueryParam("user") // because a user name may be used to authorize others' repos
-	if authUser == "" {
-		authUser = c.Param("user") // the default
+// tokenForRequest resolves the GitHub token to use for a request against
+// repo: the token of whichever user the request's `?t=` signed embed token
+// is scoped to -- provided the token is unexpired, unrevoked, and its repo
+// glob actually matches repo. A `?t=` is required; without one there's
+// nothing proving the caller is entitled to spend the repo owner's GitHub
+// quota, so the request is rejected rather than silently falling back to
+// `:user`'s own cached token.
+func tokenForRequest(c echo.Context, repo string) (string, error) {
+	t := c.QueryParam("t")
+	if t == "" {
+		return "", echo.NewHTTPError(403, "missing ?t= embed token.")
 	}
 
-	token, err := rds.Get("token:" + authUser).Result()
+	claims, err := verifyEmbedToken(t)
 	if err != nil {
-		return echo.NewHTTPError(404, "user doesn't have a valid GitHub token registered.")
+		return "", echo.NewHTTPError(403, err.Error())
+	}
+	if !repoGlobMatches(claims.RepoGlob, repo) {
+		return "", echo.NewHTTPError(403, "embed token isn't scoped to this repo.")
 	}
 
-	repo := c.Param("user") + "/" + c.Param("repo")
-	stats := GitHubStats{}
+	token, err := cache.Get("token:" + claims.User)
+	if err != nil {
+		return "", echo.NewHTTPError(404, "user doesn't have a valid GitHub token registered.")
+	}
+	return string(token), nil
+}
+
+// chartFormat is the output format negotiated for drawChart: the 800x300
+// PNG by default, but also SVG or a raw JSON stats dump on request.
+type chartFormat int
+
+const (
+	formatPNG chartFormat = iota
+	formatSVG
+	formatJSON
+)
+
+// negotiateFormat figures out which format was requested, either via a
+// .json/.svg/.png extension on the repo name or the Accept header, and
+// returns the repo name with any such extension stripped back off.
+func negotiateFormat(c echo.Context) (chartFormat, string) {
+	repoParam := c.Param("repo")
+
+	switch {
+	case strings.HasSuffix(repoParam, ".json"):
+		return formatJSON, strings.TrimSuffix(repoParam, ".json")
+	case strings.HasSuffix(repoParam, ".svg"):
+		return formatSVG, strings.TrimSuffix(repoParam, ".svg")
+	case strings.HasSuffix(repoParam, ".png"):
+		return formatPNG, strings.TrimSuffix(repoParam, ".png")
+	}
+
+	switch c.Request().Header.Get("Accept") {
+	case "application/json":
+		return formatJSON, repoParam
+	case "image/svg+xml":
+		return formatSVG, repoParam
+	}
+
+	return formatPNG, repoParam
+}
+
+// chartStatsResponse is the JSON representation of drawChart's data,
+// served when the client asks for application/json instead of an image.
+type chartStatsResponse struct {
+	GitHubStats
+	Total14DaysViews   int `json:"total_14_days_views"`
+	Total14DaysUniques int `json:"total_14_days_uniques"`
+}
+
+func drawChart(c echo.Context) error {
+	format, repoName := negotiateFormat(c)
+	repo := c.Param("user") + "/" + repoName
 	log.Print("~ view: " + repo)
 
-	// try to fetch cached data from redis
-	rediskey := "stats:" + repo
-	cached, err := rds.Get(rediskey).Bytes()
-	if err == nil && cached != nil && len(cached) > 0 {
-		if err := json.Unmarshal(cached, &stats); err != nil {
-			log.Print("data at cache is invalid: ", string(cached), " // ", err)
-		} else {
-			log.Print("cache hit")
-		}
-	} else {
-		// get data from github
-		headers := &http.Header{}
-		headers.Set("User-Agent", "https://github.com/fiatjaf/ght")
-		headers.Set("Accept", "application/vnd.github.v3+json")
-		headers.Set("Authorization", "token "+token)
-		if _, err = napping.Send(&napping.Request{
-			Url:    "https://api.github.com/repos/" + repo + "/traffic/views",
-			Method: "GET",
-			Header: headers,
-			Result: &stats,
-		}); err != nil {
-			return err
-		} else if len(stats.Views) == 0 {
-			log.Print("no data received from GitHub.")
-		}
+	token, err := tokenForRequest(c, repo)
+	if err != nil {
+		return err
+	}
+
+	stats, err := fetchStats(c, repo, token)
+	if err != nil {
+		return err
+	}
 
-		// cache results on redis
-		expiration := time.Hour * 2
-		stats.Expires = time.Now().Add(time.Hour * 2).Format(time.RFC1123)
-		cache, _ := json.Marshal(stats)
-		if err = rds.Set(rediskey, cache, expiration).Err(); err != nil {
-			log.Print("failed to cache results on redis: ", err)
+	if format == formatJSON {
+		resp := chartStatsResponse{GitHubStats: stats}
+		for _, v := range stats.Views {
+			resp.Total14DaysViews += v.Count
+			resp.Total14DaysUniques += v.Uniques
 		}
+		c.Response().Header().Set("Cache-Control", "no-cache")
+		return c.JSON(200, resp)
 	}
 
 	// build chart
@@ -280,9 +337,195 @@ func drawChart(c echo.Context) error {
 		chart.Legend(&graph),
 	}
 
-	c.Response().Header().Set("Content-Type", "image/png")
 	c.Response().Header().Set("Cache-Control", "no-cache")
 	c.Response().Header().Set("Expires", stats.Expires)
+	if format == formatSVG {
+		c.Response().Header().Set("Content-Type", "image/svg+xml")
+		graph.Render(chart.SVG, c.Response())
+		return nil
+	}
+
+	c.Response().Header().Set("Content-Type", "image/png")
 	graph.Render(chart.PNG, c.Response())
 	return nil
 }
+
+// badgeColors maps shields.io-style named colors to their hex values.
+var badgeColors = map[string]string{
+	"brightgreen": "#4c1",
+	"green":       "#97ca00",
+	"yellowgreen": "#a4a61d",
+	"yellow":      "#dfb317",
+	"orange":      "#fe7d37",
+	"red":         "#e05d44",
+	"blue":        "#007ec6",
+	"lightgrey":   "#9f9f9f",
+	"grey":        "#555",
+}
+
+const badgeHeight = 20
+
+var betweenTags = regexp.MustCompile(`>\s+<`)
+
+// badgeTextWidth approximates the rendered width, in pixels, of s when set
+// in Verdana 11px -- the same estimate shields.io uses for its badges.
+func badgeTextWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			width += 7
+		case r == ' ':
+			width += 4
+		case r >= 'a' && r <= 'z':
+			width += 6
+		default:
+			width += 7
+		}
+	}
+	return width
+}
+
+// minifySVG strips the whitespace between tags so the response is as
+// cache-friendly and bandwidth-cheap as the PNG chart isn't.
+func minifySVG(svg string) string {
+	return betweenTags.ReplaceAllString(svg, "><")
+}
+
+// renderBadge draws a shields.io-style two-section rounded rectangle badge.
+func renderBadge(label, value, color string) string {
+	hex, ok := badgeColors[color]
+	if !ok {
+		hex = badgeColors["blue"]
+	}
+
+	labelWidth := badgeTextWidth(label) + 10
+	valueWidth := badgeTextWidth(value) + 10
+	totalWidth := labelWidth + valueWidth
+
+	return minifySVG(fmt.Sprintf(`
+<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" role="img" aria-label="%s: %s">
+	<linearGradient id="s" x2="0" y2="100%%">
+		<stop offset="0" stop-color="#bbb" stop-opacity=".1"/>
+		<stop offset="1" stop-opacity=".1"/>
+	</linearGradient>
+	<clipPath id="r"><rect width="%d" height="%d" rx="3" fill="#fff"/></clipPath>
+	<g clip-path="url(#r)">
+		<rect width="%d" height="%d" fill="#555"/>
+		<rect x="%d" width="%d" height="%d" fill="%s"/>
+		<rect width="%d" height="%d" fill="url(#s)"/>
+	</g>
+	<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+		<text x="%d" y="14">%s</text>
+		<text x="%d" y="14">%s</text>
+	</g>
+</svg>`,
+		totalWidth, badgeHeight, label, value,
+		totalWidth, badgeHeight,
+		labelWidth, badgeHeight,
+		labelWidth, valueWidth, badgeHeight, hex,
+		totalWidth, badgeHeight,
+		labelWidth/2, label,
+		labelWidth+valueWidth/2, value,
+	))
+}
+
+// drawBadge renders a lightweight shields.io-style SVG badge showing a
+// single traffic metric, meant for embedding in READMEs where the 800x300
+// PNG chart from drawChart is too heavy.
+func drawBadge(c echo.Context) error {
+	metric := c.QueryParam("metric")
+	if metric == "" {
+		metric = "views"
+	}
+
+	color := c.QueryParam("color")
+	if color == "" {
+		color = "brightgreen"
+	}
+
+	repo := c.Param("user") + "/" + c.Param("repo")
+	token, err := tokenForRequest(c, repo)
+	if err != nil {
+		return err
+	}
+
+	var label string
+	var value int
+	switch metric {
+	case "views":
+		stats, err := fetchStats(c, repo, token)
+		if err != nil {
+			return err
+		}
+		label = "views"
+		value = stats.Count
+	case "uniques":
+		stats, err := fetchStats(c, repo, token)
+		if err != nil {
+			return err
+		}
+		label = "unique"
+		value = stats.Uniques
+	case "stars":
+		n, err := fetchStars(repo, token)
+		if err != nil {
+			return err
+		}
+		label = "stars"
+		value = n
+	case "clones":
+		clones, err := fetchClones(c, repo, token)
+		if err != nil {
+			return err
+		}
+		label = "clones"
+		value = clones.Count
+	default:
+		return echo.NewHTTPError(400, "unknown metric: "+metric)
+	}
+
+	c.Response().Header().Set("Content-Type", "image/svg+xml")
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	return c.String(200, renderBadge(label, fmt.Sprintf("%d", value), color))
+}
+
+const statsCacheTTL = time.Hour * 2
+
+// fetchStats fetches and caches the GitHub traffic/views stats for repo,
+// so both drawChart and drawBadge can reuse the same cache entry.
+func fetchStats(c echo.Context, repo, token string) (GitHubStats, error) {
+	stats := GitHubStats{}
+
+	payload, err := fetchCached(c, "stats:"+repo, statsCacheTTL, func() ([]byte, error) {
+		gh := sharedGitHubClient(token)
+		var fresh GitHubStats
+		if err := gh.Get("https://api.github.com/repos/"+repo+"/traffic/views", &fresh); err != nil {
+			return nil, err
+		}
+		fresh.Expires = time.Now().Add(statsCacheTTL).Format(time.RFC1123)
+		return json.Marshal(fresh)
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	if err := json.Unmarshal(payload, &stats); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// fetchStars fetches the repo's current stargazer count from GitHub.
+func fetchStars(repo, token string) (int, error) {
+	repoInfo := struct {
+		StargazersCount int `json:"stargazers_count"`
+	}{}
+
+	gh := sharedGitHubClient(token)
+	if err := gh.Get("https://api.github.com/repos/"+repo, &repoInfo); err != nil {
+		return 0, err
+	}
+
+	return repoInfo.StargazersCount, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+var (
+	ErrSessionInvalid = errors.New("session is invalid")
+	ErrSessionExpired = errors.New("session has expired")
+)
+
+// sessionCookieName is the cookie set at /_callback once a user has
+// completed GitHub OAuth, proving to later dashboard requests which GitHub
+// login they actually are.
+const sessionCookieName = "ght_session"
+
+// sessionTTL mirrors embedTokenDefaultTTL: a user who links their GitHub
+// account stays logged into their own dashboard for 30 days before having
+// to go through /_authorize again.
+const sessionTTL = time.Hour * 24 * 30
+
+// sessionClaims is the payload signed into the session cookie.
+type sessionClaims struct {
+	User string `json:"user"`
+	Exp  int64  `json:"exp"`
+}
+
+// signSession signs a session cookie value identifying user.
+func signSession(user string) (string, error) {
+	payload, err := json.Marshal(sessionClaims{
+		User: user,
+		Exp:  time.Now().Add(sessionTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	return encodedPayload + "." + signSessionPayload(encodedPayload), nil
+}
+
+// verifySession checks a session cookie's signature and expiry, returning
+// the claims it encodes.
+func verifySession(token string) (sessionClaims, error) {
+	dot := strings.LastIndex(token, ".")
+	if dot < 0 {
+		return sessionClaims{}, ErrSessionInvalid
+	}
+	encodedPayload, sig := token[:dot], token[dot+1:]
+
+	if !hmac.Equal([]byte(sig), []byte(signSessionPayload(encodedPayload))) {
+		return sessionClaims{}, ErrSessionInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return sessionClaims{}, ErrSessionInvalid
+	}
+
+	var claims sessionClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return sessionClaims{}, ErrSessionInvalid
+	}
+
+	if time.Now().Unix() > claims.Exp {
+		return sessionClaims{}, ErrSessionExpired
+	}
+
+	return claims, nil
+}
+
+// signSessionPayload signs encodedPayload with a key derived from
+// s.EmbedSecret but distinct from the one embed tokens use, so a session
+// cookie can never be replayed as a `?t=` embed token or vice versa.
+func signSessionPayload(encodedPayload string) string {
+	mac := hmac.New(sha256.New, []byte(s.EmbedSecret+":session"))
+	mac.Write([]byte(encodedPayload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// setSessionCookie signs a session cookie for user and attaches it to c's
+// response.
+func setSessionCookie(c echo.Context, user string) error {
+	value, err := signSession(user)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(c.Response(), &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    value,
+		Path:     "/",
+		Expires:  time.Now().Add(sessionTTL),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// requireSession checks that the caller's session cookie identifies the
+// same GitHub login as the dashboard's :user path param, so dashboard
+// routes can't be driven against someone else's account just by knowing
+// their GitHub username.
+func requireSession(c echo.Context) error {
+	cookie, err := c.Request().Cookie(sessionCookieName)
+	if err != nil {
+		return echo.NewHTTPError(401, "not logged in -- visit /_authorize first.")
+	}
+
+	claims, err := verifySession(cookie.Value)
+	if err != nil {
+		return echo.NewHTTPError(401, err.Error())
+	}
+
+	if !strings.EqualFold(claims.User, c.Param("user")) {
+		return echo.NewHTTPError(403, "can't manage another user's dashboard.")
+	}
+
+	return nil
+}
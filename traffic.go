@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+)
+
+const (
+	clonesCacheTTL    = time.Hour * 2
+	referrersCacheTTL = time.Hour
+	pathsCacheTTL     = time.Hour
+)
+
+type GitHubClones struct {
+	Expires string `json:"expires"`
+	Count   int    `json:"count"`
+	Uniques int    `json:"uniques"`
+	Clones  []struct {
+		Count     int    `json:"count"`
+		Timestamp string `json:"timestamp"`
+		Uniques   int    `json:"uniques"`
+	} `json:"clones"`
+}
+
+type GitHubReferrer struct {
+	Referrer string `json:"referrer"`
+	Count    int    `json:"count"`
+	Uniques  int    `json:"uniques"`
+}
+
+type GitHubPath struct {
+	Path    string `json:"path"`
+	Title   string `json:"title"`
+	Count   int    `json:"count"`
+	Uniques int    `json:"uniques"`
+}
+
+// fetchClones fetches and caches the GitHub traffic/clones stats for repo.
+func fetchClones(c echo.Context, repo, token string) (GitHubClones, error) {
+	clones := GitHubClones{}
+
+	payload, err := fetchCached(c, "clones:"+repo, clonesCacheTTL, func() ([]byte, error) {
+		gh := sharedGitHubClient(token)
+		var fresh GitHubClones
+		if err := gh.Get("https://api.github.com/repos/"+repo+"/traffic/clones", &fresh); err != nil {
+			return nil, err
+		}
+		fresh.Expires = time.Now().Add(clonesCacheTTL).Format(time.RFC1123)
+		return json.Marshal(fresh)
+	})
+	if err != nil {
+		return clones, err
+	}
+
+	if err := json.Unmarshal(payload, &clones); err != nil {
+		return clones, err
+	}
+	return clones, nil
+}
+
+// fetchReferrers fetches and caches the GitHub traffic/popular/referrers
+// list for repo. Unlike fetchStats and fetchClones, no "expires" timestamp
+// is stamped onto this list, so only the cache TTL applies.
+func fetchReferrers(c echo.Context, repo, token string) ([]GitHubReferrer, error) {
+	var referrers []GitHubReferrer
+
+	payload, err := fetchCached(c, "referrers:"+repo, referrersCacheTTL, func() ([]byte, error) {
+		gh := sharedGitHubClient(token)
+		var fresh []GitHubReferrer
+		if err := gh.Get("https://api.github.com/repos/"+repo+"/traffic/popular/referrers", &fresh); err != nil {
+			return nil, err
+		}
+		return json.Marshal(fresh)
+	})
+	if err != nil {
+		return referrers, err
+	}
+
+	if err := json.Unmarshal(payload, &referrers); err != nil {
+		return referrers, err
+	}
+	return referrers, nil
+}
+
+// fetchPaths fetches and caches the GitHub traffic/popular/paths list for
+// repo.
+func fetchPaths(c echo.Context, repo, token string) ([]GitHubPath, error) {
+	var paths []GitHubPath
+
+	payload, err := fetchCached(c, "paths:"+repo, pathsCacheTTL, func() ([]byte, error) {
+		gh := sharedGitHubClient(token)
+		var fresh []GitHubPath
+		if err := gh.Get("https://api.github.com/repos/"+repo+"/traffic/popular/paths", &fresh); err != nil {
+			return nil, err
+		}
+		return json.Marshal(fresh)
+	})
+	if err != nil {
+		return paths, err
+	}
+
+	if err := json.Unmarshal(payload, &paths); err != nil {
+		return paths, err
+	}
+	return paths, nil
+}
+
+// drawClones renders a dual-line chart (count + uniques) for the repo's
+// git clone traffic, the clones equivalent of drawChart.
+func drawClones(c echo.Context) error {
+	repo := c.Param("user") + "/" + c.Param("repo")
+	token, err := tokenForRequest(c, repo)
+	if err != nil {
+		return err
+	}
+	clones, err := fetchClones(c, repo, token)
+	if err != nil {
+		return err
+	}
+
+	uniqueClones := chart.TimeSeries{
+		Name: "Unique cloners",
+		Style: chart.Style{
+			Show:        true,
+			StrokeWidth: 5.2,
+			StrokeColor: drawing.Color{52, 116, 219, 100},
+			FillColor:   drawing.Color{52, 116, 219, 37},
+			DotColorProvider: func(_, _ chart.Range, _ int, _, _ float64) drawing.Color {
+				return drawing.Color{52, 116, 219, 100}
+			},
+			DotWidthProvider: func(_, _ chart.Range, _ int, _, _ float64) float64 {
+				return 5
+			},
+		},
+		XValues: make([]time.Time, len(clones.Clones)),
+		YValues: make([]float64, len(clones.Clones)),
+		YAxis:   chart.YAxisPrimary,
+	}
+	totalClones := chart.TimeSeries{
+		Name: "Clones",
+		Style: chart.Style{
+			Show:        true,
+			StrokeWidth: 4.3,
+			StrokeColor: drawing.Color{21, 198, 148, 100},
+			DotColorProvider: func(_, _ chart.Range, _ int, _, _ float64) drawing.Color {
+				return drawing.Color{21, 198, 148, 100}
+			},
+			DotWidthProvider: func(_, _ chart.Range, _ int, _, _ float64) float64 {
+				return 5
+			},
+		},
+		XValues: make([]time.Time, len(clones.Clones)),
+		YValues: make([]float64, len(clones.Clones)),
+		YAxis:   chart.YAxisSecondary,
+	}
+
+	for i, stat := range clones.Clones {
+		date, _ := time.Parse("2006-01-02T15:04:05Z", stat.Timestamp)
+		uniqueClones.XValues[i] = date
+		totalClones.XValues[i] = date
+		uniqueClones.YValues[i] = float64(stat.Uniques)
+		totalClones.YValues[i] = float64(stat.Count)
+	}
+
+	graph := chart.Chart{
+		Title: repo + " clones",
+		TitleStyle: chart.Style{
+			Show:      true,
+			FontColor: drawing.Color{52, 23, 119, 100},
+		},
+		Background: chart.Style{
+			Padding: chart.Box{Top: 50, Right: 10, Bottom: 10, Left: 27},
+		},
+
+		Width:  800,
+		Height: 300,
+
+		Series: []chart.Series{uniqueClones, totalClones},
+		XAxis: chart.XAxis{
+			Style: chart.Style{Show: true},
+			ValueFormatter: func(v interface{}) string {
+				return time.Unix(0, int64(v.(float64))).Format("Jan 02")
+			},
+		},
+		YAxis: chart.YAxis{
+			Name:      "Unique cloners",
+			NameStyle: chart.StyleShow(),
+			Style:     chart.Style{Show: true},
+			ValueFormatter: func(v interface{}) string {
+				return fmt.Sprintf("%.1f", v.(float64))
+			},
+		},
+		YAxisSecondary: chart.YAxis{
+			Name:      "Clones",
+			NameStyle: chart.StyleShow(),
+			Style:     chart.Style{Show: true},
+			ValueFormatter: func(v interface{}) string {
+				return fmt.Sprintf("%.1f", v.(float64))
+			},
+		},
+	}
+
+	graph.Elements = []chart.Renderable{
+		chart.Legend(&graph),
+	}
+
+	c.Response().Header().Set("Content-Type", "image/png")
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	c.Response().Header().Set("Expires", clones.Expires)
+	graph.Render(chart.PNG, c.Response())
+	return nil
+}
+
+// drawReferrers renders a horizontal bar chart of the repo's top referrers.
+func drawReferrers(c echo.Context) error {
+	repo := c.Param("user") + "/" + c.Param("repo")
+	token, err := tokenForRequest(c, repo)
+	if err != nil {
+		return err
+	}
+	referrers, err := fetchReferrers(c, repo, token)
+	if err != nil {
+		return err
+	}
+
+	return renderBarChart(c, repo+" referrers", referrersToBars(referrers))
+}
+
+func referrersToBars(referrers []GitHubReferrer) []chart.Value {
+	bars := make([]chart.Value, len(referrers))
+	for i, r := range referrers {
+		bars[i] = chart.Value{Value: float64(r.Count), Label: r.Referrer}
+	}
+	return bars
+}
+
+// drawPaths renders a horizontal bar chart of the repo's top content paths.
+func drawPaths(c echo.Context) error {
+	repo := c.Param("user") + "/" + c.Param("repo")
+	token, err := tokenForRequest(c, repo)
+	if err != nil {
+		return err
+	}
+	paths, err := fetchPaths(c, repo, token)
+	if err != nil {
+		return err
+	}
+
+	return renderBarChart(c, repo+" paths", pathsToBars(paths))
+}
+
+func pathsToBars(paths []GitHubPath) []chart.Value {
+	bars := make([]chart.Value, len(paths))
+	for i, p := range paths {
+		label := p.Title
+		if label == "" {
+			label = p.Path
+		}
+		bars[i] = chart.Value{Value: float64(p.Count), Label: label}
+	}
+	return bars
+}
+
+// renderBarChart draws and writes a horizontal bar chart SVG of bars to c's
+// response, shared between drawReferrers and drawPaths. go-chart only ships
+// vertical bar charts, so this builds the SVG by hand, the same way
+// renderBadge does for badges.
+func renderBarChart(c echo.Context, title string, bars []chart.Value) error {
+	const (
+		width      = 800
+		padding    = 20
+		titleSpace = 40
+		rowHeight  = 32
+		labelWidth = 220
+		valueSpace = 60
+	)
+	barAreaWidth := width - padding*2 - labelWidth - valueSpace
+	height := padding*2 + titleSpace + rowHeight*len(bars)
+
+	max := 0.0
+	for _, bar := range bars {
+		if bar.Value > max {
+			max = bar.Value
+		}
+	}
+	if max == 0 {
+		max = 1
+	}
+
+	var rows strings.Builder
+	for i, bar := range bars {
+		y := padding + titleSpace + i*rowHeight
+		barWidth := int(bar.Value / max * float64(barAreaWidth))
+		if barWidth < 1 && bar.Value > 0 {
+			barWidth = 1
+		}
+		fmt.Fprintf(&rows,
+			`<text x="%d" y="%d" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="12" fill="#333">%s</text>
+<rect x="%d" y="%d" width="%d" height="%d" fill="#3474db"/>
+<text x="%d" y="%d" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="12" fill="#333">%.0f</text>`,
+			padding, y+rowHeight/2+4, html.EscapeString(bar.Label),
+			padding+labelWidth, y+6, barWidth, rowHeight-12,
+			padding+labelWidth+barWidth+8, y+rowHeight/2+4, bar.Value,
+		)
+	}
+
+	svg := fmt.Sprintf(`
+<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" role="img" aria-label="%s">
+	<rect width="%d" height="%d" fill="#fff"/>
+	<text x="%d" y="%d" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="16" fill="#321777">%s</text>
+	%s
+</svg>`,
+		width, height, html.EscapeString(title),
+		width, height,
+		padding, padding+16, html.EscapeString(title),
+		rows.String(),
+	)
+
+	c.Response().Header().Set("Content-Type", "image/svg+xml")
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	return c.String(200, minifySVG(svg))
+}